@@ -0,0 +1,50 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+// InPlaceUpdateDecisionCondition is set on a Machine every time the KubeadmControlPlane reconciler
+// decides whether the Machine can be updated in-place instead of being rolled out, recording the
+// outcome of that decision for `kubectl describe machine` and other observability tooling.
+const InPlaceUpdateDecisionCondition = "InPlaceUpdateDecision"
+
+// Reasons for the InPlaceUpdateDecisionCondition.
+const (
+	// InPlaceUpdateDecisionFeatureGateDisabledReason is used when the InPlaceUpdates feature gate is disabled.
+	InPlaceUpdateDecisionFeatureGateDisabledReason = "FeatureGateDisabled"
+
+	// InPlaceUpdateDecisionMissingObjectsReason is used when the Machine, its KubeadmConfig or its
+	// InfrastructureMachine are not (yet) available to compute the decision.
+	InPlaceUpdateDecisionMissingObjectsReason = "MissingObjects"
+
+	// InPlaceUpdateDecisionNoExtensionRegisteredReason is used when no CanUpdateMachine Runtime SDK
+	// extension is registered and InPlaceUpdatePolicy has no CEL rules configured either.
+	InPlaceUpdateDecisionNoExtensionRegisteredReason = "NoExtensionRegistered"
+
+	// InPlaceUpdateDecisionCELRuleRejectedReason is used when an InPlaceUpdatePolicy CEL rule evaluated to false.
+	InPlaceUpdateDecisionCELRuleRejectedReason = "CELRuleRejected"
+
+	// InPlaceUpdateDecisionSpecStillDiffersReason is used when every CanUpdateMachine extension in the
+	// chain has been called, but current still doesn't match desired.
+	InPlaceUpdateDecisionSpecStillDiffersReason = "SpecStillDiffers"
+
+	// InPlaceUpdateDecisionExtensionRejectedReason is used when a CanUpdateMachine extension's patch
+	// conflicts with a patch already applied by a previous extension in the chain.
+	InPlaceUpdateDecisionExtensionRejectedReason = "ExtensionRejected"
+
+	// InPlaceUpdateDecisionUpdatableReason is used when the Machine can be updated in-place.
+	InPlaceUpdateDecisionUpdatableReason = "Updatable"
+)
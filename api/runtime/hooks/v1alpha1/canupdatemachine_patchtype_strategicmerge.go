@@ -0,0 +1,23 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// StrategicMergePatchType is a PatchType that applies a strategic merge patch, i.e. the same patch
+// semantics used by `kubectl apply`. Unlike JSONMergePatchType, list fields that are recognized by the
+// target Go type (e.g. via patchMergeKey/patchStrategy struct tags) are merged by key instead of being
+// replaced wholesale.
+const StrategicMergePatchType PatchType = "StrategicMergePatch"
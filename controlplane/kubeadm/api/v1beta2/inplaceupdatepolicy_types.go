@@ -0,0 +1,51 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+// InPlaceUpdatePolicy lets cluster operators declare, inline on the KubeadmControlPlane, whether a
+// Machine change is safe to apply in-place without requiring a Runtime SDK CanUpdateMachine extension
+// to be deployed.
+type InPlaceUpdatePolicy struct {
+	// celRules is a list of CEL rules evaluated against the current and desired state of a Machine to
+	// decide if it can be updated in-place.
+	// All rules must evaluate to true for the Machine to be considered in-place updatable. If any rule
+	// evaluates to false, the Machine is rolled out and that rule's message is surfaced as the reason.
+	// If celRules is empty, the decision is left entirely to registered CanUpdateMachine extensions.
+	// +optional
+	// +kubebuilder:validation:MaxItems=20
+	CELRules []CELRule `json:"celRules,omitempty"`
+}
+
+// CELRule is a single CEL predicate evaluated as part of an InPlaceUpdatePolicy.
+type CELRule struct {
+	// name is a human-readable identifier for this rule, included in the error reported when its
+	// expression fails to compile or evaluate. It is not part of the reason recorded when the rule
+	// evaluates to false; that reason is the rule's message.
+	// +kubebuilder:validation:MaxLength=256
+	Name string `json:"name"`
+
+	// expression is a CEL expression evaluated against `current` and `desired`, each exposing `machine`,
+	// `bootstrapConfig` and `infrastructureMachine`, built the same way as the CanUpdateMachine Runtime
+	// SDK request. The expression must evaluate to a bool.
+	// +kubebuilder:validation:MaxLength=4096
+	Expression string `json:"expression"`
+
+	// message is surfaced as the reason a Machine is rolled out instead of updated in-place when this
+	// rule evaluates to false.
+	// +kubebuilder:validation:MaxLength=256
+	Message string `json:"message"`
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubeadmControlPlaneSpec defines the desired state of KubeadmControlPlane.
+//
+// NOTE: this repository snapshot does not vendor the full upstream KubeadmControlPlane API (machine
+// template, rollout/remediation/naming strategy, etc.) - only the fields the in-place update planner
+// reads are declared here. Reconcile any change to this struct against the real
+// sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta2 package, and regenerate deepcopy with the
+// real controller-gen, before this lands upstream.
+type KubeadmControlPlaneSpec struct {
+	// version defines the desired Kubernetes version.
+	// +kubebuilder:validation:MinLength=1
+	Version string `json:"version"`
+
+	// inPlaceUpdatePolicy lets cluster operators declare, inline on the KubeadmControlPlane, whether a
+	// Machine change is safe to apply in-place without requiring a Runtime SDK CanUpdateMachine
+	// extension to be deployed. See InPlaceUpdatePolicy for details.
+	// +optional
+	InPlaceUpdatePolicy InPlaceUpdatePolicy `json:"inPlaceUpdatePolicy,omitempty"`
+}
+
+// KubeadmControlPlaneStatus defines the observed state of KubeadmControlPlane.
+type KubeadmControlPlaneStatus struct {
+	// conditions represents the observations of a KubeadmControlPlane's current state.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// KubeadmControlPlane is the Schema for the KubeadmControlPlane API.
+type KubeadmControlPlane struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KubeadmControlPlaneSpec   `json:"spec,omitempty"`
+	Status KubeadmControlPlaneStatus `json:"status,omitempty"`
+}
+
+// KubeadmControlPlaneList contains a list of KubeadmControlPlane.
+type KubeadmControlPlaneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubeadmControlPlane `json:"items"`
+}
@@ -18,119 +18,350 @@ package controllers
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 
+	"gitpro.ttaallkk.top/google/cel-go/cel"
+	"gitpro.ttaallkk.top/google/go-cmp/cmp"
 	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/discovery"
 	"k8s.io/klog/v2"
+	"k8s.io/kubectl/pkg/util/openapi"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	bootstrapv1 "sigs.k8s.io/cluster-api/api/bootstrap/kubeadm/v1beta2"
 	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
 	runtimehooksv1 "sigs.k8s.io/cluster-api/api/runtime/hooks/v1alpha1"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta2"
 	"sigs.k8s.io/cluster-api/controlplane/kubeadm/internal"
-	"sigs.k8s.io/cluster-api/feature"
 	"sigs.k8s.io/cluster-api/internal/util/compare"
 	patchutil "sigs.k8s.io/cluster-api/internal/util/patch"
 	"sigs.k8s.io/cluster-api/internal/util/ssa"
+	"sigs.k8s.io/cluster-api/util/conditions"
 )
 
-func (r *KubeadmControlPlaneReconciler) canUpdateMachine(ctx context.Context, machine *clusterv1.Machine, machineUpToDateResult internal.UpToDateResult) (bool, error) {
-	if r.overrideCanUpdateMachineFunc != nil {
-		return r.overrideCanUpdateMachineFunc(ctx, machine, machineUpToDateResult)
-	}
+// lookupPatchMetaFunc lazily computes the strategic merge patch metadata for an object, so it is only
+// resolved (and, for Unstructured objects, fetched from the management cluster's OpenAPI schema) when a
+// CanUpdateMachine extension actually returns a StrategicMergePatchType patch.
+type lookupPatchMetaFunc func() (strategicpatch.LookupPatchMeta, error)
 
-	log := ctrl.LoggerFrom(ctx)
+// inPlaceOpenAPIPatchMetaCache caches the strategic merge patch metadata derived from the management
+// cluster's OpenAPI schema for InfrastructureMachine types, keyed by GroupVersionKind. Fetching and
+// parsing the full OpenAPI schema is expensive, so once the patch metadata for a GVK is resolved it is
+// reused; a failed lookup is not cached and is attempted again on the next call.
+var inPlaceOpenAPIPatchMetaCache = &openAPIPatchMetaCache{byGVK: map[schema.GroupVersionKind]strategicpatch.LookupPatchMeta{}}
 
-	// Machine cannot be updated in-place if the feature gate is not enabled.
-	if !feature.Gates.Enabled(feature.InPlaceUpdates) {
-		return false, nil
+type openAPIPatchMetaCache struct {
+	mu    sync.RWMutex
+	byGVK map[schema.GroupVersionKind]strategicpatch.LookupPatchMeta
+}
+
+func (c *openAPIPatchMetaCache) forGVK(discoveryClient discovery.OpenAPISchemaInterface, gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error) {
+	c.mu.RLock()
+	cached, ok := c.byGVK[gvk]
+	c.mu.RUnlock()
+	if ok {
+		return cached, nil
 	}
 
-	// Machine cannot be updated in-place if the UpToDate func was not able to provide all objects,
-	// e.g. if the InfraMachine or KubeadmConfig was deleted.
-	if machineUpToDateResult.DesiredMachine == nil ||
-		machineUpToDateResult.CurrentInfraMachine == nil ||
-		machineUpToDateResult.DesiredInfraMachine == nil ||
-		machineUpToDateResult.CurrentKubeadmConfig == nil ||
-		machineUpToDateResult.DesiredKubeadmConfig == nil {
-		return false, nil
+	if discoveryClient == nil {
+		return nil, errors.Errorf("failed to compute a strategic merge patch for %s: no OpenAPI schema client is configured, use JSONMergePatchType instead", gvk)
 	}
 
-	extensionHandlers, err := r.RuntimeClient.GetAllExtensions(ctx, runtimehooksv1.CanUpdateMachine, machine)
+	resources, err := openapi.NewOpenAPIGetter(discoveryClient).Get()
 	if err != nil {
-		return false, err
+		return nil, errors.Wrap(err, "failed to fetch OpenAPI schema from the management cluster")
 	}
-	// Machine cannot be updated in-place if no CanUpdateMachine extensions are registered.
-	if len(extensionHandlers) == 0 {
-		return false, nil
+	protoSchema := resources.LookupResource(gvk)
+	if protoSchema == nil {
+		return nil, errors.Errorf("failed to compute a strategic merge patch for %s: no OpenAPI schema is published for this type, use JSONMergePatchType instead", gvk)
 	}
-	if len(extensionHandlers) > 1 {
-		return false, errors.Errorf("found multiple CanUpdateMachine hooks (%s) (more than one is not supported yet)", strings.Join(extensionHandlers, ","))
+
+	patchMeta := strategicpatch.NewPatchMetaFromOpenAPI(protoSchema)
+	c.mu.Lock()
+	c.byGVK[gvk] = patchMeta
+	c.mu.Unlock()
+	return patchMeta, nil
+}
+
+// inPlaceUpdateDecisionUnknownReasons are InPlaceUpdateDecision reasons reported as
+// metav1.ConditionUnknown rather than metav1.ConditionFalse: they mean a precondition for even attempting
+// the in-place vs. rollout decision isn't met yet (the feature is off, or the Machine/KubeadmConfig/
+// InfraMachine objects needed to evaluate it don't all exist yet), not that the decision was made and came
+// out "no".
+var inPlaceUpdateDecisionUnknownReasons = map[string]bool{
+	clusterv1.InPlaceUpdateDecisionFeatureGateDisabledReason: true,
+	clusterv1.InPlaceUpdateDecisionMissingObjectsReason:      true,
+}
+
+// canUpdateMachine decides if machine can be updated in-place instead of being rolled out, and records
+// that decision on an InPlaceUpdateDecision condition (plus a matching Event) on machine before returning,
+// so the outcome of every evaluation - not just the final "yes"/"no" - is observable via `kubectl describe`.
+func (r *KubeadmControlPlaneReconciler) canUpdateMachine(ctx context.Context, kcp *controlplanev1.KubeadmControlPlane, machine *clusterv1.Machine, machineUpToDateResult internal.UpToDateResult) (canUpdateMachineResult bool, reterr error) {
+	if r.overrideCanUpdateMachineFunc != nil {
+		return r.overrideCanUpdateMachineFunc(ctx, kcp, machine, machineUpToDateResult)
 	}
 
-	canUpdateMachine, reasons, err := r.canExtensionsUpdateMachine(ctx, machine, machineUpToDateResult, extensionHandlers)
+	log := ctrl.LoggerFrom(ctx)
+
+	var reason, message string
+	defer func() {
+		// Only record a decision if we actually reached one; on unexpected errors there is nothing
+		// meaningful to report other than the error itself, which is already returned to the caller.
+		if reterr != nil || reason == "" {
+			return
+		}
+		status := metav1.ConditionFalse
+		switch {
+		case canUpdateMachineResult:
+			status = metav1.ConditionTrue
+		case inPlaceUpdateDecisionUnknownReasons[reason]:
+			status = metav1.ConditionUnknown
+		}
+		r.recordInPlaceUpdateDecision(ctx, machine, status, reason, message)
+	}()
+
+	// Delegate to InPlacePlanner.Plan, the single code path shared with the preview subresource served by
+	// InPlaceUpdatePreviewHandler, so the reconciler's decision and the preview's can never drift.
+	plan, err := r.inPlacePlanner().Plan(ctx, kcp, machine, machineUpToDateResult)
 	if err != nil {
 		return false, err
 	}
-	if !canUpdateMachine {
-		log.Info(fmt.Sprintf("Machine cannot be updated in-place by extensions: %s", strings.Join(reasons, ",")), "Machine", klog.KObj(machine))
-		return false, nil
+	reason = plan.Reason
+	message = plan.Message
+
+	switch reason {
+	case clusterv1.InPlaceUpdateDecisionCELRuleRejectedReason:
+		log.Info(fmt.Sprintf("Machine cannot be updated in-place by InPlaceUpdatePolicy CEL rules: %s", message), "Machine", klog.KObj(machine))
+	case clusterv1.InPlaceUpdateDecisionSpecStillDiffersReason, clusterv1.InPlaceUpdateDecisionExtensionRejectedReason:
+		log.Info(fmt.Sprintf("Machine cannot be updated in-place by extensions: %s", message), "Machine", klog.KObj(machine))
 	}
-	return true, nil
+	return plan.CanUpdateMachine, nil
+}
+
+// recordInPlaceUpdateDecision sets the InPlaceUpdateDecision condition on machine and records a matching
+// Event, so the decision made by canUpdateMachine is visible both chronologically (via the Event) and as
+// the Machine's current state (via the condition).
+func (r *KubeadmControlPlaneReconciler) recordInPlaceUpdateDecision(ctx context.Context, machine *clusterv1.Machine, status metav1.ConditionStatus, reason, message string) {
+	conditions.Set(machine, metav1.Condition{
+		Type:               clusterv1.InPlaceUpdateDecisionCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: machine.Generation,
+	})
+
+	eventType := corev1.EventTypeNormal
+	if status != metav1.ConditionTrue {
+		eventType = corev1.EventTypeWarning
+	}
+	r.recorder.Event(machine, eventType, reason, message)
+}
+
+// ExtensionReason records why a single CanUpdateMachine extension did or did not consider a Machine
+// in-place updatable, so callers and tests can introspect which hook in the chain blocked the update.
+type ExtensionReason struct {
+	// Handler is the name of the CanUpdateMachine extension handler.
+	Handler string
+	// Reasons explain why the extension's patches did not make current match desired, or why the
+	// extension was skipped due to a conflict with a previous extension in the chain.
+	Reasons []string
+	// Conflict is true if Reasons describes a conflict with a previous extension in the chain, rather
+	// than current still not matching desired after the extension's patches were applied.
+	Conflict bool
+}
+
+func joinExtensionReasons(extensionReasons []ExtensionReason) string {
+	parts := make([]string, 0, len(extensionReasons))
+	for _, extensionReason := range extensionReasons {
+		parts = append(parts, fmt.Sprintf("%s: %s", extensionReason.Handler, strings.Join(extensionReason.Reasons, ",")))
+	}
+	return strings.Join(parts, "; ")
 }
 
 // canExtensionsUpdateMachine calls CanUpdateMachine extensions to decide if a Machine can be updated in-place.
+// Extensions are called as a chain, in the order given by extensionHandlers: each extension sees the request
+// as patched by every extension called before it, so independent extensions can cooperate (e.g. one patches
+// the KubeadmConfig, another patches the InfrastructureMachine). The Machine is in-place updatable as soon as
+// any prefix of the chain makes current match desired; it is not necessary to call every extension.
+// If an extension's patch touches a field a previous extension in the chain already patched, the conflict is
+// recorded as a reason and the chain stops there, since the two extensions disagree on how to reach desired.
 // Note: This is following the same general structure that is used in the Apply func in
 // internal/controllers/topology/cluster/patches/engine.go.
-func (r *KubeadmControlPlaneReconciler) canExtensionsUpdateMachine(ctx context.Context, machine *clusterv1.Machine, machineUpToDateResult internal.UpToDateResult, extensionHandlers []string) (bool, []string, error) {
+func (r *KubeadmControlPlaneReconciler) canExtensionsUpdateMachine(ctx context.Context, req *runtimehooksv1.CanUpdateMachineRequest, machine *clusterv1.Machine, extensionHandlers []string) (bool, []ExtensionReason, []FieldDiff, error) {
 	if r.overrideCanExtensionsUpdateMachine != nil {
-		return r.overrideCanExtensionsUpdateMachine(ctx, machine, machineUpToDateResult, extensionHandlers)
+		return r.overrideCanExtensionsUpdateMachine(ctx, req, machine, extensionHandlers)
 	}
+	return canExtensionsUpdateMachineWithCaller(ctx, r.RuntimeClient, r.DiscoveryClient, req, machine, extensionHandlers)
+}
 
+// canExtensionsUpdateMachineWithCaller is the runtime-client-parameterized implementation of
+// canExtensionsUpdateMachine, factored out so InPlacePlanner can share it without depending on a
+// KubeadmControlPlaneReconciler.
+func canExtensionsUpdateMachineWithCaller(ctx context.Context, runtimeClient runtimeExtensionCaller, discoveryClient discovery.OpenAPISchemaInterface, req *runtimehooksv1.CanUpdateMachineRequest, machine *clusterv1.Machine, extensionHandlers []string) (bool, []ExtensionReason, []FieldDiff, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	// Create the CanUpdateMachine request.
-	req, err := createRequest(ctx, r.Client, machine, machineUpToDateResult)
-	if err != nil {
-		return false, nil, errors.Wrapf(err, "failed to generate CanUpdateMachine request")
-	}
+	// touchedFields tracks which extension last touched a given field path, so a later extension
+	// patching the same field can be detected as a conflict instead of silently overwriting it.
+	touchedFields := map[string]string{}
 
-	var reasons []string
+	var extensionReasons []ExtensionReason
+	var lastFieldDiffs []FieldDiff
 	for _, extensionHandler := range extensionHandlers {
 		// Call CanUpdateMachine extension.
 		resp := &runtimehooksv1.CanUpdateMachineResponse{}
-		if err := r.RuntimeClient.CallExtension(ctx, runtimehooksv1.CanUpdateMachine, machine, extensionHandler, req, resp); err != nil {
-			return false, nil, err
+		if err := runtimeClient.CallExtension(ctx, runtimehooksv1.CanUpdateMachine, machine, extensionHandler, req, resp); err != nil {
+			return false, nil, nil, err
+		}
+
+		conflictReasons, err := recordPatchedFields(touchedFields, extensionHandler, resp)
+		if err != nil {
+			return false, nil, nil, errors.Wrapf(err, "failed to inspect patches returned by extension %s", extensionHandler)
+		}
+		if len(conflictReasons) > 0 {
+			extensionReasons = append(extensionReasons, ExtensionReason{Handler: extensionHandler, Reasons: conflictReasons, Conflict: true})
+			log.Info(fmt.Sprintf("Machine cannot be updated in-place: extension %s conflicts with a previous extension: %s", extensionHandler, strings.Join(conflictReasons, ",")), "Machine", klog.KObj(&req.Current.Machine))
+			return false, extensionReasons, nil, nil
 		}
 
 		// Apply patches from the CanUpdateMachine response to the request.
-		if err := applyPatchesToRequest(ctx, req, resp); err != nil {
-			return false, nil, errors.Wrapf(err, "failed to apply patches from extension %s to the CanUpdateMachine request", extensionHandler)
+		if err := applyPatchesToRequestWithDiscoveryClient(ctx, discoveryClient, req, resp); err != nil {
+			return false, nil, nil, errors.Wrapf(err, "failed to apply patches from extension %s to the CanUpdateMachine request", extensionHandler)
 		}
 
 		// Check if current and desired objects are now matching.
-		var matches bool
-		matches, reasons, err = matchesMachine(req)
+		matches, reasons, fieldDiffs, err := matchesMachine(req)
 		if err != nil {
-			return false, nil, errors.Wrapf(err, "failed to compare current and desired objects after calling extension %s", extensionHandler)
+			return false, nil, nil, errors.Wrapf(err, "failed to compare current and desired objects after calling extension %s", extensionHandler)
 		}
+		extensionReasons = append(extensionReasons, ExtensionReason{Handler: extensionHandler, Reasons: reasons})
 		if matches {
-			return true, nil, nil
+			return true, nil, nil, nil
+		}
+		for i := range fieldDiffs {
+			fieldDiffs[i].Handler = extensionHandler
 		}
+		lastFieldDiffs = fieldDiffs
 		log.V(5).Info(fmt.Sprintf("Machine cannot be updated in-place yet after calling extension %s: %s", extensionHandler, strings.Join(reasons, ",")), "Machine", klog.KObj(&req.Current.Machine))
 	}
 
-	return false, reasons, nil
+	return false, extensionReasons, lastFieldDiffs, nil
+}
+
+// recordPatchedFields extracts the field paths patched by resp and records extensionHandler as their
+// owner in touchedFields. It returns a reason per field that was already touched by a previous extension.
+func recordPatchedFields(touchedFields map[string]string, extensionHandler string, resp *runtimehooksv1.CanUpdateMachineResponse) ([]string, error) {
+	var fieldPaths []string
+	for objName, patch := range map[string]runtimehooksv1.Patch{
+		"Machine":               resp.MachinePatch,
+		"BootstrapConfig":       resp.BootstrapConfigPatch,
+		"InfrastructureMachine": resp.InfrastructureMachinePatch,
+	} {
+		if !patch.IsDefined() {
+			continue
+		}
+		paths, err := extractPatchedFieldPaths(objName, patch)
+		if err != nil {
+			return nil, err
+		}
+		fieldPaths = append(fieldPaths, paths...)
+	}
+
+	var conflictReasons []string
+	for _, fieldPath := range fieldPaths {
+		if owner, ok := touchedFields[fieldPath]; ok {
+			conflictReasons = append(conflictReasons, fmt.Sprintf("field %s was already patched by extension %s", fieldPath, owner))
+			continue
+		}
+		touchedFields[fieldPath] = extensionHandler
+	}
+	return conflictReasons, nil
+}
+
+// extractPatchedFieldPaths returns the leaf field paths that patch would change on an object named
+// objName, as RFC6901 JSON pointers rooted at objName (e.g. "Machine/spec/version"), the same
+// representation for every patch type so a JSONPatchType extension and a merge-patch extension touching
+// the same leaf field are detected as a conflict. For JSONPatchType the paths are read directly from the
+// patch operations; for JSONMergePatchType and StrategicMergePatchType the patch document is walked down
+// to its leaves, so two patches that both touch a top-level field (e.g. "spec") but disjoint sub-fields
+// (e.g. "spec.files" vs. "spec.preKubeadmCommands") are not mistaken for a conflict.
+func extractPatchedFieldPaths(objName string, patch runtimehooksv1.Patch) ([]string, error) {
+	switch patch.PatchType {
+	case runtimehooksv1.JSONPatchType:
+		ops, err := jsonpatch.DecodePatch(patch.Patch)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode json patch (RFC6902)")
+		}
+		paths := make([]string, 0, len(ops))
+		for _, op := range ops {
+			path, err := op.Path()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read path of json patch operation")
+			}
+			paths = append(paths, fmt.Sprintf("%s%s", objName, path))
+		}
+		return paths, nil
+	case runtimehooksv1.JSONMergePatchType, runtimehooksv1.StrategicMergePatchType:
+		if len(patch.Patch) == 0 || bytes.Equal(patch.Patch, []byte("{}")) {
+			return nil, nil
+		}
+		var doc interface{}
+		if err := json.Unmarshal(patch.Patch, &doc); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal merge patch")
+		}
+		leaves := mergePatchLeafPointers("", doc)
+		paths := make([]string, 0, len(leaves))
+		for _, leaf := range leaves {
+			paths = append(paths, objName+leaf)
+		}
+		sort.Strings(paths)
+		return paths, nil
+	default:
+		return nil, errors.Errorf("unknown patchType %s", patch.PatchType)
+	}
+}
+
+// mergePatchLeafPointers walks a decoded JSON merge/strategic-merge patch document and returns the RFC6901
+// JSON pointers of its leaves, relative to pointerPrefix. A key is a leaf if its value is not itself a
+// non-empty JSON object - in particular arrays are leaves, so patches touching different elements of the
+// same list report the same path, even for a strategic merge patch that merges list elements by key.
+func mergePatchLeafPointers(pointerPrefix string, value interface{}) []string {
+	obj, ok := value.(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		if pointerPrefix == "" {
+			return nil
+		}
+		return []string{pointerPrefix}
+	}
+	var leaves []string
+	for key, v := range obj {
+		leaves = append(leaves, mergePatchLeafPointers(pointerPrefix+"/"+jsonPointerEscape(key), v)...)
+	}
+	return leaves
+}
+
+// jsonPointerEscape escapes a single JSON object key for use as an RFC6901 JSON pointer reference token.
+func jsonPointerEscape(key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	key = strings.ReplaceAll(key, "/", "~1")
+	return key
 }
 
 func createRequest(ctx context.Context, c client.Client, currentMachine *clusterv1.Machine, machineUpToDateResult internal.UpToDateResult) (*runtimehooksv1.CanUpdateMachineRequest, error) {
@@ -278,7 +509,14 @@ func convertToRawExtension(object runtime.Object) (runtime.RawExtension, error)
 	}, nil
 }
 
-func applyPatchesToRequest(ctx context.Context, req *runtimehooksv1.CanUpdateMachineRequest, resp *runtimehooksv1.CanUpdateMachineResponse) error {
+func (r *KubeadmControlPlaneReconciler) applyPatchesToRequest(ctx context.Context, req *runtimehooksv1.CanUpdateMachineRequest, resp *runtimehooksv1.CanUpdateMachineResponse) error {
+	return applyPatchesToRequestWithDiscoveryClient(ctx, r.DiscoveryClient, req, resp)
+}
+
+// applyPatchesToRequestWithDiscoveryClient is the discovery-client-parameterized implementation of
+// applyPatchesToRequest, factored out so InPlacePlanner can share it without depending on a
+// KubeadmControlPlaneReconciler.
+func applyPatchesToRequestWithDiscoveryClient(ctx context.Context, discoveryClient discovery.OpenAPISchemaInterface, req *runtimehooksv1.CanUpdateMachineRequest, resp *runtimehooksv1.CanUpdateMachineResponse) error {
 	if resp.MachinePatch.IsDefined() {
 		if err := applyPatchToMachine(ctx, &req.Current.Machine, resp.MachinePatch); err != nil {
 			return err
@@ -286,13 +524,18 @@ func applyPatchesToRequest(ctx context.Context, req *runtimehooksv1.CanUpdateMac
 	}
 
 	if resp.BootstrapConfigPatch.IsDefined() {
-		if _, err := applyPatchToObject(ctx, &req.Current.BootstrapConfig, resp.BootstrapConfigPatch); err != nil {
+		if _, err := applyPatchToObject(ctx, &req.Current.BootstrapConfig, resp.BootstrapConfigPatch, func() (strategicpatch.LookupPatchMeta, error) {
+			return strategicpatch.NewPatchMetaFromStruct(&bootstrapv1.KubeadmConfig{})
+		}); err != nil {
 			return err
 		}
 	}
 
 	if resp.InfrastructureMachinePatch.IsDefined() {
-		if _, err := applyPatchToObject(ctx, &req.Current.InfrastructureMachine, resp.InfrastructureMachinePatch); err != nil {
+		infraMachineGVK := req.Current.InfrastructureMachine.Object.GetObjectKind().GroupVersionKind()
+		if _, err := applyPatchToObject(ctx, &req.Current.InfrastructureMachine, resp.InfrastructureMachinePatch, func() (strategicpatch.LookupPatchMeta, error) {
+			return inPlaceOpenAPIPatchMetaCache.forGVK(discoveryClient, infraMachineGVK)
+		}); err != nil {
 			return err
 		}
 	}
@@ -308,7 +551,9 @@ func applyPatchToMachine(ctx context.Context, currentMachine *clusterv1.Machine,
 		return err
 	}
 
-	machineChanged, err := applyPatchToObject(ctx, &currentMachineRaw, machinePath)
+	machineChanged, err := applyPatchToObject(ctx, &currentMachineRaw, machinePath, func() (strategicpatch.LookupPatchMeta, error) {
+		return strategicpatch.NewPatchMetaFromStruct(&clusterv1.Machine{})
+	})
 	if err != nil {
 		return err
 	}
@@ -327,9 +572,11 @@ func applyPatchToMachine(ctx context.Context, currentMachine *clusterv1.Machine,
 }
 
 // applyPatchToObject applies the patch to the obj.
+// lookupPatchMeta is only invoked for StrategicMergePatchType patches, to lazily resolve the patch
+// metadata required to merge list fields by key instead of replacing them wholesale.
 // Note: This is following the same general structure that is used in the applyPatchToRequest func in
 // internal/controllers/topology/cluster/patches/engine.go.
-func applyPatchToObject(ctx context.Context, obj *runtime.RawExtension, patch runtimehooksv1.Patch) (objChanged bool, reterr error) {
+func applyPatchToObject(ctx context.Context, obj *runtime.RawExtension, patch runtimehooksv1.Patch, lookupPatchMeta lookupPatchMetaFunc) (objChanged bool, reterr error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	if patch.PatchType == "" {
@@ -379,6 +626,24 @@ func applyPatchToObject(ctx context.Context, obj *runtime.RawExtension, patch ru
 			log.Error(err, "Failed to apply patch: error applying json merge patch (RFC7386)", "patch", string(patch.Patch))
 			return false, errors.Wrap(err, "failed to apply patch: error applying json merge patch (RFC7386)")
 		}
+	case runtimehooksv1.StrategicMergePatchType:
+		if len(patch.Patch) == 0 || bytes.Equal(patch.Patch, []byte("{}")) {
+			// Return if there are no patches, nothing to do.
+			return false, nil
+		}
+
+		patchMeta, err := lookupPatchMeta()
+		if err != nil {
+			log.Error(err, "Failed to apply patch: error computing strategic merge patch metadata")
+			return false, errors.Wrap(err, "failed to apply patch: error computing strategic merge patch metadata")
+		}
+
+		log.V(5).Info("Accumulating strategic merge patch", "patch", string(patch.Patch))
+		patchedObject, err = strategicpatch.StrategicMergePatchUsingLookupPatchMeta(patchedObject, patch.Patch, patchMeta)
+		if err != nil {
+			log.Error(err, "Failed to apply patch: error applying strategic merge patch", "patch", string(patch.Patch))
+			return false, errors.Wrap(err, "failed to apply patch: error applying strategic merge patch")
+		}
 	default:
 		return false, errors.Errorf("failed to apply patch: unknown patchType %s", patch.PatchType)
 	}
@@ -392,71 +657,376 @@ func applyPatchToObject(ctx context.Context, obj *runtime.RawExtension, patch ru
 	return true, nil
 }
 
-func matchesMachine(req *runtimehooksv1.CanUpdateMachineRequest) (bool, []string, error) {
+func matchesMachine(req *runtimehooksv1.CanUpdateMachineRequest) (bool, []string, []FieldDiff, error) {
 	var reasons []string
-	match, diff, err := matchesMachineSpec(&req.Current.Machine, &req.Desired.Machine)
+	var fieldDiffs []FieldDiff
+	match, diff, diffs, err := matchesMachineSpec(&req.Current.Machine, &req.Desired.Machine)
 	if err != nil {
-		return false, nil, errors.Wrapf(err, "failed to match Machine")
+		return false, nil, nil, errors.Wrapf(err, "failed to match Machine")
 	}
 	if !match {
 		reasons = append(reasons, fmt.Sprintf("Machine cannot be updated in-place: %s", diff))
+		fieldDiffs = append(fieldDiffs, prefixFieldDiffs("Machine", diffs)...)
 	}
-	match, diff, err = matchesUnstructuredSpec(req.Current.BootstrapConfig, req.Desired.BootstrapConfig)
+	match, diff, diffs, err = matchesUnstructuredSpec(req.Current.BootstrapConfig, req.Desired.BootstrapConfig)
 	if err != nil {
-		return false, nil, errors.Wrapf(err, "failed to match KubeadmConfig")
+		return false, nil, nil, errors.Wrapf(err, "failed to match KubeadmConfig")
 	}
 	if !match {
 		reasons = append(reasons, fmt.Sprintf("KubeadmConfig cannot be updated in-place: %s", diff))
+		fieldDiffs = append(fieldDiffs, prefixFieldDiffs("KubeadmConfig", diffs)...)
 	}
-	match, diff, err = matchesUnstructuredSpec(req.Current.InfrastructureMachine, req.Desired.InfrastructureMachine)
+	infrastructureMachineKind := req.Current.InfrastructureMachine.Object.GetObjectKind().GroupVersionKind().Kind
+	match, diff, diffs, err = matchesUnstructuredSpec(req.Current.InfrastructureMachine, req.Desired.InfrastructureMachine)
 	if err != nil {
-		return false, nil, errors.Wrapf(err, "failed to match %s", req.Current.InfrastructureMachine.Object.GetObjectKind().GroupVersionKind().Kind)
+		return false, nil, nil, errors.Wrapf(err, "failed to match %s", infrastructureMachineKind)
 	}
 	if !match {
-		reasons = append(reasons, fmt.Sprintf("%s cannot be updated in-place: %s", req.Current.InfrastructureMachine.Object.GetObjectKind().GroupVersionKind().Kind, diff))
+		reasons = append(reasons, fmt.Sprintf("%s cannot be updated in-place: %s", infrastructureMachineKind, diff))
+		fieldDiffs = append(fieldDiffs, prefixFieldDiffs(infrastructureMachineKind, diffs)...)
 	}
 
 	if len(reasons) > 0 {
-		return false, reasons, nil
+		return false, reasons, fieldDiffs, nil
 	}
 
-	return true, nil, nil
+	return true, nil, nil, nil
 }
 
-func matchesMachineSpec(patched, desired *clusterv1.Machine) (equal bool, diff string, matchErr error) {
+func matchesMachineSpec(patched, desired *clusterv1.Machine) (equal bool, diff string, fieldDiffs []FieldDiff, matchErr error) {
 	// Note: Wrapping Machine specs in a Machine for proper formatting of the diff.
-	return compare.Diff(
-		&clusterv1.Machine{
-			Spec: patched.Spec,
-		},
-		&clusterv1.Machine{
-			Spec: desired.Spec,
-		},
-	)
+	patchedForDiff := &clusterv1.Machine{Spec: patched.Spec}
+	desiredForDiff := &clusterv1.Machine{Spec: desired.Spec}
+	equal, diff, matchErr = compare.Diff(patchedForDiff, desiredForDiff)
+	if matchErr != nil || equal {
+		return equal, diff, nil, matchErr
+	}
+	return equal, diff, diffFields(desiredForDiff, patchedForDiff), nil
 }
 
-func matchesUnstructuredSpec(patched, desired runtime.RawExtension) (equal bool, diff string, matchErr error) {
+func matchesUnstructuredSpec(patched, desired runtime.RawExtension) (equal bool, diff string, fieldDiffs []FieldDiff, matchErr error) {
 	// Note: Both patched and desired objects are always Unstructured as createRequest and
 	//       applyPatchToObject are always setting objects as Unstructured.
 	patchedUnstructured, ok := patched.Object.(*unstructured.Unstructured)
 	if !ok {
-		return false, "", errors.Errorf("patched object is not an Unstructured")
+		return false, "", nil, errors.Errorf("patched object is not an Unstructured")
 	}
 	desiredUnstructured, ok := desired.Object.(*unstructured.Unstructured)
 	if !ok {
-		return false, "", errors.Errorf("desired object is not an Unstructured")
+		return false, "", nil, errors.Errorf("desired object is not an Unstructured")
 	}
 	// Note: Wrapping Unstructured specs in an Unstructured for proper formatting of the diff.
-	return compare.Diff(
-		&unstructured.Unstructured{
-			Object: map[string]interface{}{
-				"spec": patchedUnstructured.Object["spec"],
-			},
+	patchedForDiff := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": patchedUnstructured.Object["spec"],
 		},
-		&unstructured.Unstructured{
-			Object: map[string]interface{}{
-				"spec": desiredUnstructured.Object["spec"],
-			},
+	}
+	desiredForDiff := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": desiredUnstructured.Object["spec"],
 		},
+	}
+	equal, diff, matchErr = compare.Diff(patchedForDiff, desiredForDiff)
+	if matchErr != nil || equal {
+		return equal, diff, nil, matchErr
+	}
+	return equal, diff, diffFields(desiredForDiff.Object, patchedForDiff.Object), nil
+}
+
+// FieldDiff is a single leaf-level field difference between a patched current object and its desired
+// counterpart, used to build a compact, machine-readable InPlaceUpdateDecision condition message instead
+// of an opaque diff string.
+type FieldDiff struct {
+	// Field is the leaf field path the difference was found at, e.g. ".Spec.Version" or ".spec.files[0].path".
+	Field string `json:"field"`
+	// CurrentValue is the value of Field on the (patched) current object.
+	CurrentValue interface{} `json:"currentValue"`
+	// DesiredValue is the value of Field on the desired object.
+	DesiredValue interface{} `json:"desiredValue"`
+	// Handler is the name of the CanUpdateMachine extension whose patches were applied when this diff
+	// was computed. Left empty when the diff isn't associated with a specific extension.
+	Handler string `json:"handler,omitempty"`
+}
+
+func prefixFieldDiffs(objName string, fieldDiffs []FieldDiff) []FieldDiff {
+	prefixed := make([]FieldDiff, len(fieldDiffs))
+	for i, fieldDiff := range fieldDiffs {
+		fieldDiff.Field = objName + fieldDiff.Field
+		prefixed[i] = fieldDiff
+	}
+	return prefixed
+}
+
+// encodeFieldDiffsMessage renders fieldDiffs as a compact JSON array for use as a condition Message.
+func encodeFieldDiffsMessage(fieldDiffs []FieldDiff) string {
+	if len(fieldDiffs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(fieldDiffs)
+	if err != nil {
+		// Fall back to a best-effort message rather than losing the decision reason entirely.
+		return fmt.Sprintf("failed to encode field diffs: %v", err)
+	}
+	return string(data)
+}
+
+// diffFields walks the cmp.Diff output for desired vs. current and extracts leaf-level field diffs,
+// instead of the opaque diff string compare.Diff produces, so the result can be surfaced as structured
+// data in the InPlaceUpdateDecision condition message.
+func diffFields(desired, current interface{}) []FieldDiff {
+	reporter := &fieldDiffReporter{}
+	cmp.Diff(desired, current, cmp.Reporter(reporter))
+	return reporter.diffs
+}
+
+// fieldDiffReporter is a cmp.Reporter that only records leaf-level differences (scalars, or the closest
+// point at which one side is missing), rather than every ancestor struct/map/slice that contains one.
+type fieldDiffReporter struct {
+	path  cmp.Path
+	diffs []FieldDiff
+}
+
+func (r *fieldDiffReporter) PushStep(ps cmp.PathStep) {
+	r.path = append(r.path, ps)
+}
+
+func (r *fieldDiffReporter) Report(rs cmp.Result) {
+	if rs.Equal() {
+		return
+	}
+	desiredValue, currentValue := r.path.Last().Values()
+	if !isLeafDiff(desiredValue, currentValue) {
+		return
+	}
+	// Build the path from struct fields, map keys and slice indexes; cmp.Path.String only renders struct
+	// fields (without a leading dot), which leaves paths into Unstructured objects empty.
+	var field strings.Builder
+	for _, step := range r.path {
+		switch s := step.(type) {
+		case cmp.StructField:
+			field.WriteString("." + s.Name())
+		case cmp.MapIndex:
+			fmt.Fprintf(&field, ".%v", s.Key())
+		case cmp.SliceIndex:
+			fmt.Fprintf(&field, "[%d]", s.Key())
+		}
+	}
+	r.diffs = append(r.diffs, FieldDiff{
+		Field:        field.String(),
+		CurrentValue: interfaceOf(currentValue),
+		DesiredValue: interfaceOf(desiredValue),
+	})
+}
+
+func (r *fieldDiffReporter) PopStep() {
+	r.path = r.path[:len(r.path)-1]
+}
+
+// isLeafDiff reports whether a difference at this step should be recorded here, rather than left for a
+// more specific diff to be reported once cmp recurses into the value's fields/elements.
+func isLeafDiff(values ...reflect.Value) bool {
+	v := values[0]
+	if !v.IsValid() {
+		v = values[1]
+	}
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		return false
+	default:
+		return true
+	}
+}
+
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// inPlaceCELRuleCacheMaxEntries bounds inPlaceCELRuleCache so it cannot grow without bound over the life
+// of the controller-manager process as KubeadmControlPlanes are created and deleted across the cluster's
+// lifetime; KCPs beyond this count are evicted least-recently-used first.
+const inPlaceCELRuleCacheMaxEntries = 1024
+
+// inPlaceCELRuleCache caches compiled CEL programs for a KubeadmControlPlane's InPlaceUpdatePolicy CEL
+// rules, keyed by the KCP's UID. Entries are recompiled whenever the KCP's generation changes, i.e.
+// whenever the rules themselves (or anything else in spec) could have changed.
+var inPlaceCELRuleCache = newCELRuleCache(inPlaceCELRuleCacheMaxEntries)
+
+type celRuleCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	byKCP      map[types.UID]*list.Element
+	lru        *list.List // holds celRuleCacheEntry, most-recently-used at the front
+}
+
+type celRuleCacheEntry struct {
+	kcpUID     types.UID
+	generation int64
+	programs   []cel.Program
+}
+
+func newCELRuleCache(maxEntries int) *celRuleCache {
+	return &celRuleCache{
+		maxEntries: maxEntries,
+		byKCP:      map[types.UID]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func (c *celRuleCache) forKCP(kcp *controlplanev1.KubeadmControlPlane) ([]cel.Program, error) {
+	c.mu.Lock()
+	if elem, ok := c.byKCP[kcp.UID]; ok {
+		entry := elem.Value.(celRuleCacheEntry)
+		if entry.generation == kcp.Generation {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			return entry.programs, nil
+		}
+	}
+	c.mu.Unlock()
+
+	programs, err := compileCELRules(kcp.Spec.InPlaceUpdatePolicy.CELRules)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.byKCP[kcp.UID]; ok {
+		c.lru.Remove(elem)
+	}
+	c.byKCP[kcp.UID] = c.lru.PushFront(celRuleCacheEntry{kcpUID: kcp.UID, generation: kcp.Generation, programs: programs})
+	for len(c.byKCP) > c.maxEntries {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.lru.Remove(oldest)
+		delete(c.byKCP, oldest.Value.(celRuleCacheEntry).kcpUID)
+	}
+	return programs, nil
+}
+
+// celRuleEnv declares the CEL environment shared by all InPlaceUpdatePolicy CEL rules: `current` and
+// `desired`, each a map built from the same cleaned-up objects the CanUpdateMachine request is built from.
+func celRuleEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("current", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("desired", cel.MapType(cel.StringType, cel.DynType)),
 	)
 }
+
+func compileCELRules(rules []controlplanev1.CELRule) ([]cel.Program, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	env, err := celRuleEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create CEL environment for InPlaceUpdatePolicy")
+	}
+
+	programs := make([]cel.Program, 0, len(rules))
+	for _, rule := range rules {
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, errors.Wrapf(issues.Err(), "failed to compile CEL rule %q", rule.Name)
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create CEL program for rule %q", rule.Name)
+		}
+		programs = append(programs, program)
+	}
+	return programs, nil
+}
+
+// evaluateInPlaceUpdateCELRules evaluates kcp's InPlaceUpdatePolicy CEL rules, if any, against req.
+// decided is false if InPlaceUpdatePolicy has no CELRules configured, in which case the Machine's
+// in-place updatability is left to CanUpdateMachine extensions. If decided is true, canUpdate and
+// reasons report the outcome: canUpdate is true only if every rule evaluated to true.
+func evaluateInPlaceUpdateCELRules(kcp *controlplanev1.KubeadmControlPlane, req *runtimehooksv1.CanUpdateMachineRequest) (decided bool, canUpdate bool, reasons []string, reterr error) {
+	rules := kcp.Spec.InPlaceUpdatePolicy.CELRules
+	if len(rules) == 0 {
+		return false, false, nil, nil
+	}
+
+	programs, err := inPlaceCELRuleCache.forKCP(kcp)
+	if err != nil {
+		return true, false, nil, errors.Wrap(err, "failed to compile InPlaceUpdatePolicy CEL rules")
+	}
+
+	input, err := celRuleInput(req)
+	if err != nil {
+		return true, false, nil, errors.Wrap(err, "failed to build input for InPlaceUpdatePolicy CEL rules")
+	}
+
+	for i, program := range programs {
+		out, _, err := program.Eval(input)
+		if err != nil {
+			return true, false, nil, errors.Wrapf(err, "failed to evaluate CEL rule %q", rules[i].Name)
+		}
+		result, ok := out.Value().(bool)
+		if !ok {
+			return true, false, nil, errors.Errorf("CEL rule %q did not evaluate to a bool", rules[i].Name)
+		}
+		if !result {
+			return true, false, []string{rules[i].Message}, nil
+		}
+	}
+	return true, true, nil, nil
+}
+
+// celRuleInput builds the `current`/`desired` CEL input from req, using the same cleaned-up Machine /
+// BootstrapConfig / InfrastructureMachine objects the CanUpdateMachine request itself carries.
+func celRuleInput(req *runtimehooksv1.CanUpdateMachineRequest) (map[string]interface{}, error) {
+	current, err := celRequestObjects(req.Current)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert current objects for CEL evaluation")
+	}
+	desired, err := celRequestObjects(req.Desired)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert desired objects for CEL evaluation")
+	}
+	return map[string]interface{}{
+		"current": current,
+		"desired": desired,
+	}, nil
+}
+
+func celRequestObjects(objs runtimehooksv1.CanUpdateMachineRequestObjects) (map[string]interface{}, error) {
+	machine, err := toCELMap(&objs.Machine)
+	if err != nil {
+		return nil, err
+	}
+	bootstrapConfig, err := toCELMap(objs.BootstrapConfig.Object)
+	if err != nil {
+		return nil, err
+	}
+	infrastructureMachine, err := toCELMap(objs.InfrastructureMachine.Object)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"machine":               machine,
+		"bootstrapConfig":       bootstrapConfig,
+		"infrastructureMachine": infrastructureMachine,
+	}, nil
+}
+
+func toCELMap(obj runtime.Object) (map[string]interface{}, error) {
+	objBytes, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal object")
+	}
+	objMap := map[string]interface{}{}
+	if err := json.Unmarshal(objBytes, &objMap); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal object")
+	}
+	return objMap, nil
+}
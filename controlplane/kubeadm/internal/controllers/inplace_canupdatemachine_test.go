@@ -0,0 +1,275 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "gitpro.ttaallkk.top/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	runtimehooksv1 "sigs.k8s.io/cluster-api/api/runtime/hooks/v1alpha1"
+)
+
+// testKubeadmConfig mirrors the subset of KubeadmConfig/KubeadmConfigSpec relevant to strategic merge
+// list semantics, with the same patchStrategy/patchMergeKey tags the real type carries for these fields,
+// so applyPatchToObject's StrategicMergePatchType handling can be exercised without depending on a live
+// management cluster's OpenAPI schema.
+type testKubeadmConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              testKubeadmConfigSpec `json:"spec,omitempty"`
+}
+
+type testKubeadmConfigSpec struct {
+	PreKubeadmCommands []string   `json:"preKubeadmCommands,omitempty" patchStrategy:"merge"`
+	Files              []testFile `json:"files,omitempty" patchStrategy:"merge" patchMergeKey:"path"`
+	Users              []testUser `json:"users,omitempty" patchStrategy:"merge" patchMergeKey:"name"`
+}
+
+type testFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content,omitempty"`
+}
+
+type testUser struct {
+	Name string `json:"name"`
+	Sudo string `json:"sudo,omitempty"`
+}
+
+func TestApplyPatchToObject_StrategicMergePatchListSemantics(t *testing.T) {
+	lookupPatchMeta := func() (strategicpatch.LookupPatchMeta, error) {
+		return strategicpatch.NewPatchMetaFromStruct(&testKubeadmConfig{})
+	}
+
+	tests := []struct {
+		name         string
+		current      testKubeadmConfigSpec
+		patch        testKubeadmConfigSpec
+		expectedSpec testKubeadmConfigSpec
+	}{
+		{
+			name: "preKubeadmCommands are merged instead of replaced",
+			current: testKubeadmConfigSpec{
+				PreKubeadmCommands: []string{"echo foo"},
+			},
+			patch: testKubeadmConfigSpec{
+				PreKubeadmCommands: []string{"echo bar"},
+			},
+			expectedSpec: testKubeadmConfigSpec{
+				// Items from the patch come before items only present on the current object.
+				PreKubeadmCommands: []string{"echo bar", "echo foo"},
+			},
+		},
+		{
+			name: "users are merged by name instead of replaced",
+			current: testKubeadmConfigSpec{
+				Users: []testUser{
+					{Name: "root", Sudo: "ALL=(ALL) ALL"},
+					{Name: "keep-me", Sudo: "ALL=(ALL) NOPASSWD:ALL"},
+				},
+			},
+			patch: testKubeadmConfigSpec{
+				Users: []testUser{
+					{Name: "root", Sudo: "ALL=(ALL) NOPASSWD:ALL"},
+					{Name: "new-user", Sudo: "ALL=(ALL) ALL"},
+				},
+			},
+			expectedSpec: testKubeadmConfigSpec{
+				Users: []testUser{
+					{Name: "root", Sudo: "ALL=(ALL) NOPASSWD:ALL"},
+					{Name: "new-user", Sudo: "ALL=(ALL) ALL"},
+					{Name: "keep-me", Sudo: "ALL=(ALL) NOPASSWD:ALL"},
+				},
+			},
+		},
+		{
+			name: "files are merged by path instead of replaced",
+			current: testKubeadmConfigSpec{
+				Files: []testFile{
+					{Path: "/etc/a", Content: "old-a"},
+					{Path: "/etc/keep", Content: "keep"},
+				},
+			},
+			patch: testKubeadmConfigSpec{
+				Files: []testFile{
+					{Path: "/etc/a", Content: "new-a"},
+					{Path: "/etc/b", Content: "new-b"},
+				},
+			},
+			expectedSpec: testKubeadmConfigSpec{
+				Files: []testFile{
+					{Path: "/etc/a", Content: "new-a"},
+					{Path: "/etc/keep", Content: "keep"},
+					{Path: "/etc/b", Content: "new-b"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			current := testKubeadmConfig{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "bootstrap.cluster.x-k8s.io/v1beta2", Kind: "KubeadmConfig"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec:       tt.current,
+			}
+			currentRaw, err := json.Marshal(current)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			patchRaw, err := json.Marshal(map[string]interface{}{"spec": tt.patch})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			obj := &runtime.RawExtension{Raw: currentRaw}
+			patch := runtimehooksv1.Patch{PatchType: runtimehooksv1.StrategicMergePatchType, Patch: patchRaw}
+
+			changed, err := applyPatchToObject(context.Background(), obj, patch, lookupPatchMeta)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(changed).To(BeTrue())
+
+			var patched testKubeadmConfig
+			g.Expect(json.Unmarshal(obj.Raw, &patched)).To(Succeed())
+			g.Expect(patched.Spec).To(Equal(tt.expectedSpec))
+		})
+	}
+}
+
+func TestApplyPatchToObject_StrategicMergePatchNoop(t *testing.T) {
+	g := NewWithT(t)
+
+	lookupPatchMeta := func() (strategicpatch.LookupPatchMeta, error) {
+		return strategicpatch.NewPatchMetaFromStruct(&testKubeadmConfig{})
+	}
+
+	current := testKubeadmConfig{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "bootstrap.cluster.x-k8s.io/v1beta2", Kind: "KubeadmConfig"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec:       testKubeadmConfigSpec{PreKubeadmCommands: []string{"echo foo"}},
+	}
+	currentRaw, err := json.Marshal(current)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	obj := &runtime.RawExtension{Raw: currentRaw}
+	patch := runtimehooksv1.Patch{PatchType: runtimehooksv1.StrategicMergePatchType, Patch: []byte("{}")}
+
+	changed, err := applyPatchToObject(context.Background(), obj, patch, lookupPatchMeta)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(changed).To(BeFalse())
+}
+
+func TestExtractPatchedFieldPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   runtimehooksv1.Patch
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "json merge patch returns leaf paths, not top-level keys",
+			patch: runtimehooksv1.Patch{
+				PatchType: runtimehooksv1.JSONMergePatchType,
+				Patch:     []byte(`{"spec":{"files":[{"path":"/a"}]}}`),
+			},
+			want: []string{"KubeadmConfig/spec/files"},
+		},
+		{
+			name: "strategic merge patch returns leaf paths",
+			patch: runtimehooksv1.Patch{
+				PatchType: runtimehooksv1.StrategicMergePatchType,
+				Patch:     []byte(`{"spec":{"preKubeadmCommands":["echo foo"]}}`),
+			},
+			want: []string{"KubeadmConfig/spec/preKubeadmCommands"},
+		},
+		{
+			name: "json patch (RFC6902) paths use the same object-rooted json pointer form",
+			patch: runtimehooksv1.Patch{
+				PatchType: runtimehooksv1.JSONPatchType,
+				Patch:     []byte(`[{"op":"replace","path":"/spec/version","value":"v1.30.0"}]`),
+			},
+			want: []string{"Machine/spec/version"},
+		},
+		{
+			name:  "empty merge patch has no patched fields",
+			patch: runtimehooksv1.Patch{PatchType: runtimehooksv1.StrategicMergePatchType, Patch: []byte("{}")},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			objName := "Machine"
+			if tt.patch.PatchType != runtimehooksv1.JSONPatchType {
+				objName = "KubeadmConfig"
+			}
+			got, err := extractPatchedFieldPaths(objName, tt.patch)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestRecordPatchedFields_DisjointSubFieldsOfSameTopLevelKeyDoNotConflict(t *testing.T) {
+	g := NewWithT(t)
+
+	touchedFields := map[string]string{}
+
+	// Extension A patches KubeadmConfig.spec.preKubeadmCommands, extension B patches
+	// KubeadmConfig.spec.files: both send a merge patch shaped like {"spec": {...}}, but they touch
+	// disjoint leaf fields and must not be reported as a conflict.
+	respA := &runtimehooksv1.CanUpdateMachineResponse{
+		BootstrapConfigPatch: runtimehooksv1.Patch{
+			PatchType: runtimehooksv1.StrategicMergePatchType,
+			Patch:     []byte(`{"spec":{"preKubeadmCommands":["echo foo"]}}`),
+		},
+	}
+	respB := &runtimehooksv1.CanUpdateMachineResponse{
+		BootstrapConfigPatch: runtimehooksv1.Patch{
+			PatchType: runtimehooksv1.StrategicMergePatchType,
+			Patch:     []byte(`{"spec":{"files":[{"path":"/a"}]}}`),
+		},
+	}
+
+	conflicts, err := recordPatchedFields(touchedFields, "extension-a", respA)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conflicts).To(BeEmpty())
+
+	conflicts, err = recordPatchedFields(touchedFields, "extension-b", respB)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conflicts).To(BeEmpty())
+
+	// A second extension patching the very same leaf field is still a conflict.
+	respC := &runtimehooksv1.CanUpdateMachineResponse{
+		BootstrapConfigPatch: runtimehooksv1.Patch{
+			PatchType: runtimehooksv1.StrategicMergePatchType,
+			Patch:     []byte(`{"spec":{"files":[{"path":"/b"}]}}`),
+		},
+	}
+	conflicts, err = recordPatchedFields(touchedFields, "extension-c", respC)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conflicts).To(ConsistOf(ContainSubstring("KubeadmConfig/spec/files")))
+}
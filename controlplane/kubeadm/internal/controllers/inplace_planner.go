@@ -0,0 +1,194 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/core/v1beta2"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/api/runtime/hooks/v1alpha1"
+	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta2"
+	"sigs.k8s.io/cluster-api/controlplane/kubeadm/internal"
+	"sigs.k8s.io/cluster-api/feature"
+)
+
+// runtimeExtensionCaller abstracts the subset of the Runtime SDK client InPlacePlanner needs to call
+// CanUpdateMachine extensions, so it can be shared between the KubeadmControlPlaneReconciler (backed by
+// its RuntimeClient) and other callers of InPlacePlanner.Plan without depending on the reconciler itself.
+type runtimeExtensionCaller interface {
+	GetAllExtensions(ctx context.Context, hook runtimehooksv1.Hook, forObject client.Object) ([]string, error)
+	CallExtension(ctx context.Context, hook runtimehooksv1.Hook, forObject client.Object, name string, request, response runtimehooksv1.RetryResponseObject) error
+}
+
+// InPlacePlanner computes whether a Machine can be updated in-place instead of being rolled out. It is the
+// single code path used by both KubeadmControlPlaneReconciler.canUpdateMachine and the preview subresource
+// served by InPlaceUpdatePreviewHandler, so the two can never drift: canUpdateMachine additionally records
+// the outcome as a condition/Event, the preview handler only reports it. It performs no writes other than
+// the server-side apply dry-runs createRequest already relies on, which makes Plan safe to call from a
+// read-only preview path as well as from the reconciler.
+type InPlacePlanner struct {
+	Client          client.Client
+	RuntimeClient   runtimeExtensionCaller
+	DiscoveryClient discovery.OpenAPISchemaInterface
+
+	// CanExtensionsUpdateMachine calls the CanUpdateMachine extension chain, if InPlaceUpdatePolicy CEL
+	// rules don't already decide the outcome. Defaults to canExtensionsUpdateMachineWithCaller using
+	// RuntimeClient/DiscoveryClient; KubeadmControlPlaneReconciler.inPlacePlanner sets this to
+	// r.canExtensionsUpdateMachine so a test override of the reconciler's extension chain also applies
+	// when canUpdateMachine calls Plan.
+	CanExtensionsUpdateMachine func(ctx context.Context, req *runtimehooksv1.CanUpdateMachineRequest, machine *clusterv1.Machine, extensionHandlers []string) (bool, []ExtensionReason, []FieldDiff, error)
+}
+
+func (p *InPlacePlanner) canExtensionsUpdateMachine(ctx context.Context, req *runtimehooksv1.CanUpdateMachineRequest, machine *clusterv1.Machine, extensionHandlers []string) (bool, []ExtensionReason, []FieldDiff, error) {
+	if p.CanExtensionsUpdateMachine != nil {
+		return p.CanExtensionsUpdateMachine(ctx, req, machine, extensionHandlers)
+	}
+	return canExtensionsUpdateMachineWithCaller(ctx, p.RuntimeClient, p.DiscoveryClient, req, machine, extensionHandlers)
+}
+
+// InPlacePlan is the outcome of planning an in-place update for a single Machine.
+type InPlacePlan struct {
+	// CanUpdateMachine is true if the Machine can be updated in-place instead of being rolled out.
+	CanUpdateMachine bool
+	// Reason is a stable machine-readable reason for the plan's outcome, using the same values as the
+	// InPlaceUpdateDecision condition's Reason.
+	Reason string
+	// Message explains the outcome: the rejecting CEL rule's message, the JSON-encoded FieldDiffs if the
+	// extension chain left current still differing from desired, or the joined extension reasons if the
+	// chain stopped early due to a conflict between extensions (in which case FieldDiffs is empty).
+	Message string
+	// FieldDiffs lists the leaf-level fields that still differ between current and desired after every
+	// extension in the chain has run. Always empty if CanUpdateMachine is true.
+	FieldDiffs []FieldDiff
+}
+
+// Plan decides if machine can be updated in-place instead of being rolled out. This is the single code
+// path shared by KubeadmControlPlaneReconciler.canUpdateMachine and PreviewInPlaceUpdate: both call
+// createRequest, evaluateInPlaceUpdateCELRules and canExtensionsUpdateMachine exactly the same way, the
+// only difference is what the caller does with the resulting InPlacePlan.
+func (p *InPlacePlanner) Plan(ctx context.Context, kcp *controlplanev1.KubeadmControlPlane, machine *clusterv1.Machine, machineUpToDateResult internal.UpToDateResult) (*InPlacePlan, error) {
+	if !feature.Gates.Enabled(feature.InPlaceUpdates) {
+		return &InPlacePlan{Reason: clusterv1.InPlaceUpdateDecisionFeatureGateDisabledReason}, nil
+	}
+
+	if machineUpToDateResult.DesiredMachine == nil ||
+		machineUpToDateResult.CurrentInfraMachine == nil ||
+		machineUpToDateResult.DesiredInfraMachine == nil ||
+		machineUpToDateResult.CurrentKubeadmConfig == nil ||
+		machineUpToDateResult.DesiredKubeadmConfig == nil {
+		return &InPlacePlan{Reason: clusterv1.InPlaceUpdateDecisionMissingObjectsReason}, nil
+	}
+
+	req, err := createRequest(ctx, p.Client, machine, machineUpToDateResult)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate CanUpdateMachine request")
+	}
+
+	if decided, canUpdate, celReasons, err := evaluateInPlaceUpdateCELRules(kcp, req); err != nil {
+		return nil, err
+	} else if decided {
+		plan := &InPlacePlan{CanUpdateMachine: canUpdate, Reason: clusterv1.InPlaceUpdateDecisionUpdatableReason}
+		if !canUpdate {
+			plan.Reason = clusterv1.InPlaceUpdateDecisionCELRuleRejectedReason
+			plan.Message = strings.Join(celReasons, "; ")
+		}
+		return plan, nil
+	}
+
+	extensionHandlers, err := p.RuntimeClient.GetAllExtensions(ctx, runtimehooksv1.CanUpdateMachine, machine)
+	if err != nil {
+		return nil, err
+	}
+	if len(extensionHandlers) == 0 {
+		return &InPlacePlan{Reason: clusterv1.InPlaceUpdateDecisionNoExtensionRegisteredReason}, nil
+	}
+	sort.Strings(extensionHandlers)
+
+	canUpdateMachine, extensionReasons, fieldDiffs, err := p.canExtensionsUpdateMachine(ctx, req, machine, extensionHandlers)
+	if err != nil {
+		return nil, err
+	}
+	if !canUpdateMachine {
+		reason := clusterv1.InPlaceUpdateDecisionSpecStillDiffersReason
+		conflict := false
+		for _, extensionReason := range extensionReasons {
+			if extensionReason.Conflict {
+				reason = clusterv1.InPlaceUpdateDecisionExtensionRejectedReason
+				conflict = true
+				break
+			}
+		}
+		// On a conflict canExtensionsUpdateMachineWithCaller stops the chain and returns no fieldDiffs, so
+		// the conflict detail recorded in extensionReasons is the only information available; otherwise
+		// fieldDiffs carries the more precise structured detail.
+		message := encodeFieldDiffsMessage(fieldDiffs)
+		if conflict {
+			message = joinExtensionReasons(extensionReasons)
+		}
+		return &InPlacePlan{Reason: reason, Message: message, FieldDiffs: fieldDiffs}, nil
+	}
+
+	return &InPlacePlan{CanUpdateMachine: true, Reason: clusterv1.InPlaceUpdateDecisionUpdatableReason}, nil
+}
+
+// MachineInPlacePreview is the verdict for a single Machine as part of a dry-run preview of the effect a
+// proposed KubeadmControlPlane spec would have on in-place updates.
+type MachineInPlacePreview struct {
+	// Machine is the name of the previewed Machine.
+	Machine string
+	// Plan is the outcome InPlacePlanner.Plan produced for this Machine.
+	Plan *InPlacePlan
+}
+
+// PreviewInPlaceUpdate runs Plan for every entry in machineUpToDateResults, without recording any
+// condition or Event, so operators can answer "if I apply this KCP spec today, which Machines would be
+// updated in-place vs. rolled out" before actually doing it. machineUpToDateResults must already reflect
+// the proposed kcp spec (i.e. DesiredMachine/DesiredKubeadmConfig/DesiredInfraMachine were computed against
+// the proposed spec, not the live one) - computing that projection is the caller's responsibility, the same
+// way it already is for the reconciler's regular rollout decision.
+func (p *InPlacePlanner) PreviewInPlaceUpdate(ctx context.Context, kcp *controlplanev1.KubeadmControlPlane, machineUpToDateResults map[*clusterv1.Machine]internal.UpToDateResult) ([]MachineInPlacePreview, error) {
+	previews := make([]MachineInPlacePreview, 0, len(machineUpToDateResults))
+	for machine, machineUpToDateResult := range machineUpToDateResults {
+		plan, err := p.Plan(ctx, kcp, machine, machineUpToDateResult)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to preview in-place update for Machine %s", machine.Name)
+		}
+		previews = append(previews, MachineInPlacePreview{Machine: machine.Name, Plan: plan})
+	}
+	sort.Slice(previews, func(i, j int) bool { return previews[i].Machine < previews[j].Machine })
+	return previews, nil
+}
+
+// inPlacePlanner returns an InPlacePlanner backed by r's Client, RuntimeClient and DiscoveryClient, with
+// CanExtensionsUpdateMachine wired to r.canExtensionsUpdateMachine so a test override of the reconciler's
+// extension chain (overrideCanExtensionsUpdateMachine) also applies here. Both canUpdateMachine and the
+// preview subresource call this, so their decisions go through the same InPlacePlanner code; a new
+// InPlacePlanner is returned on every call.
+func (r *KubeadmControlPlaneReconciler) inPlacePlanner() *InPlacePlanner {
+	return &InPlacePlanner{
+		Client:                     r.Client,
+		RuntimeClient:              r.RuntimeClient,
+		DiscoveryClient:            r.DiscoveryClient,
+		CanExtensionsUpdateMachine: r.canExtensionsUpdateMachine,
+	}
+}